@@ -0,0 +1,33 @@
+// Copyright 2018 Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command istio-lint drives Istio's custom go/analysis rules standalone, or
+// composed with upstream analyzers (e.g. via golangci-lint's custom-analyzer
+// plugin loader), so they participate in the same fact-based caching,
+// per-package parallelism, and -json diagnostic reporting as govet.
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/multichecker"
+
+	"istio.io/istio/tests/util/golinter/rules"
+)
+
+func main() {
+	multichecker.Main(
+		rules.NewSkipByShort(rules.SkipByShortConfig{
+			ExemptBuildTags: []string{"integration"},
+		}),
+	)
+}
@@ -15,82 +15,486 @@
 package rules
 
 import (
+	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/token"
 	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
 )
 
-// SkipByShort requires that a test function should have one of these pattern.
-// Pattern 1
-// func TestA(t *testing.T) {
-//   if !testing.Short() {
-//    ...
-//   }
-// }
-//
-// Pattern 2
-// func TestB(t *testing.T) {
-//   if testing.Short() {
-//     t.Skip("xxx")
-//   }
-//   ...
-// }
-type SkipByShort struct{}
-
-// NewSkipByShort creates and returns a SkipByShort object.
-func NewSkipByShort() *SkipByShort {
-	return &SkipByShort{}
-}
-
-// GetID returns skip_by_short_rule.
-func (lr *SkipByShort) GetID() string {
-	return getCallerFileName()
-}
-
-// Check verifies if aNode is a valid t.Skip(). If verification fails lrp creates a new report.
-// There are two examples for valid t.Skip().
-// case 1:
-// func Testxxx(t *testing.T) {
-// 	if !testing.Short() {
-// 	...
-// 	}
-// }
-// case 2:
-// func Testxxx(t *testing.T) {
-// 	if testing.Short() {
-//		t.Skip("xxx")
-//	}
-//	...
-// }
-func (lr *SkipByShort) Check(aNode ast.Node, fs *token.FileSet, lrp *LintReporter) {
-	if fn, isFn := aNode.(*ast.FuncDecl); isFn && strings.HasPrefix(fn.Name.Name, "Test") {
-		if len(fn.Body.List) == 0 {
-			lrp.AddReport(aNode.Pos(), fs, "Missing either 'if testing.Short() { t.Skip() }' or 'if !testing.Short() {}'")
-		} else if len(fn.Body.List) == 1 {
-			if ifStmt, ok := fn.Body.List[0].(*ast.IfStmt); ok {
-				if uExpr, ok := ifStmt.Cond.(*ast.UnaryExpr); ok {
-					if call, ok := uExpr.X.(*ast.CallExpr); ok && uExpr.Op == token.NOT {
-						if matchCallExpr(call, "testing", "Short") {
-							return
-						}
-					}
+const skipByShortDoc = `require a testing.Short guard on Test functions
+
+This analyzer reports Test functions that do not skip themselves when
+testing.Short() is set. Built-in guards are an "if !testing.Short()"
+wrapper and an early t.Skip under testing.Short() or
+testenv.Builder() == "" (see isSkipCond); the configurable guards are
+documented on SkipByShortConfig.`
+
+// SkipByShortConfig controls which guards SkipByShort accepts as
+// satisfying the -short contract, so integration/e2e suites don't have to
+// be force-fit into the unit-test idiom.
+type SkipByShortConfig struct {
+	// AllowedGuards lists additional environment-variable names that may
+	// gate a test in place of, or alongside, testing.Short(), e.g.
+	// `if os.Getenv("ISTIO_FUZZ") == "" { t.Skip(...) }` is accepted once
+	// "ISTIO_FUZZ" is listed here.
+	AllowedGuards []string
+
+	// SkipHelpers lists helper function names that are trusted to
+	// perform the skip on the test's behalf, e.g. a shared
+	// `skipIfShort(t)` call at the top of the test. A call only counts as
+	// a guard when its name is listed here AND its declaration, somewhere
+	// in the package under analysis, carries the `// istio:skipshort`
+	// marker comment; a listed name with no marked declaration in the
+	// package is not trusted.
+	SkipHelpers []string
+
+	// ExemptBuildTags lists build tags, as they'd appear in a
+	// `//go:build` line, that exempt an entire file from this rule, e.g.
+	// "integration" for suites that are never run with -short.
+	ExemptBuildTags []string
+}
+
+// NewSkipByShort builds the skipbyshort analyzer for the given config. It
+// is exposed as a constructor (rather than a package-level var) so drivers
+// can compose differently-configured instances, e.g. via
+// multichecker.Main.
+func NewSkipByShort(cfg SkipByShortConfig) *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name:     "skipbyshort",
+		Doc:      skipByShortDoc,
+		Requires: []*analysis.Analyzer{inspect.Analyzer},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			return runSkipByShort(pass, cfg)
+		},
+	}
+}
+
+func runSkipByShort(pass *analysis.Pass, cfg SkipByShortConfig) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	marked := markedSkipHelpers(pass.Files)
+
+	var curFile *ast.File
+	var curFileExempt bool
+	nodeFilter := []ast.Node{(*ast.File)(nil), (*ast.FuncDecl)(nil)}
+	insp.Preorder(nodeFilter, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.File:
+			curFile = n
+			curFileExempt = hasExemptBuildTag(n, cfg.ExemptBuildTags)
+		case *ast.FuncDecl:
+			if curFileExempt || n.Body == nil || !strings.HasPrefix(n.Name.Name, "Test") {
+				return
+			}
+			tName, ok := testingTParamName(n.Type.Params)
+			if !ok {
+				// Not a real go test func (e.g. a helper that merely
+				// starts with "Test"); nothing to check or fix.
+				return
+			}
+			checkTestFunc(pass, cfg, marked, curFile, n, tName)
+		}
+	})
+
+	return nil, nil
+}
+
+// skipHelperMarker is the doc-comment marker a helper function must carry
+// for SkipByShortConfig.SkipHelpers to trust that it performs the skip.
+const skipHelperMarker = "istio:skipshort"
+
+// markedSkipHelpers returns the set of function/method names, across files,
+// whose declaration carries the istio:skipshort marker comment.
+func markedSkipHelpers(files []*ast.File) map[string]bool {
+	marked := map[string]bool{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil {
+				continue
+			}
+			for _, c := range fn.Doc.List {
+				if strings.Contains(c.Text, skipHelperMarker) {
+					marked[fn.Name.Name] = true
+					break
 				}
 			}
+		}
+	}
+	return marked
+}
+
+// checkTestFunc reports a diagnostic for fn if neither fn's own body nor
+// every one of its t.Run subtests carries a recognized guard. A test is
+// also flagged, at each offending t.Run closure, if some but not all of
+// its subtests are guarded.
+func checkTestFunc(pass *analysis.Pass, cfg SkipByShortConfig, marked map[string]bool, file *ast.File, fn *ast.FuncDecl, tName string) {
+	if hasShortGuard(fn.Body.List, cfg, tName, marked) {
+		return
+	}
+	subtests := collectSubtests(fn.Body.List, tName)
+	if len(subtests) == 0 {
+		pass.Report(analysis.Diagnostic{
+			Pos:     fn.Pos(),
+			Message: "missing either 'if testing.Short() { t.Skip() }' or 'if !testing.Short() {}'",
+			SuggestedFixes: []analysis.SuggestedFix{
+				{
+					Message:   "insert 'if testing.Short() { t.Skip(...) }'",
+					TextEdits: skipGuardEdits(file, fn, tName),
+				},
+			},
+		})
+		return
+	}
+
+	var guarded, unguarded []*ast.FuncLit
+	for _, sub := range subtests {
+		subName, ok := subtestTParamName(sub)
+		if !ok {
+			// Not a real subtest closure (no *testing.T param); skip it
+			// rather than guess at a guard or fix for it.
+			continue
+		}
+		if isSubtestGuarded(sub, cfg, marked, subName) {
+			guarded = append(guarded, sub)
 		} else {
-			if ifStmt, ok := fn.Body.List[0].(*ast.IfStmt); ok {
-				if call, ok := ifStmt.Cond.(*ast.CallExpr); ok {
-					if matchCallExpr(call, "testing", "Short") && len(ifStmt.Body.List) > 0 {
-						if exprStmt, ok := ifStmt.Body.List[0].(*ast.ExprStmt); ok {
-							if call, ok := exprStmt.X.(*ast.CallExpr); ok {
-								if matchCallExpr(call, "t", "Skip") {
-									return
-								}
-							}
-						}
+			unguarded = append(unguarded, sub)
+		}
+	}
+	if len(unguarded) == 0 && len(guarded) > 0 {
+		return
+	}
+	if len(guarded) == 0 {
+		pass.Report(analysis.Diagnostic{
+			Pos:     fn.Pos(),
+			Message: fmt.Sprintf("missing either 'if testing.Short() { t.Skip() }' or 'if !testing.Short() {}', in the test itself or in every %s.Run subtest", tName),
+			SuggestedFixes: []analysis.SuggestedFix{
+				{
+					Message:   "insert 'if testing.Short() { t.Skip(...) }'",
+					TextEdits: skipGuardEdits(file, fn, tName),
+				},
+			},
+		})
+		return
+	}
+	for _, sub := range unguarded {
+		pass.Reportf(sub.Pos(), "inconsistent testing.Short() guard: some sibling %s.Run subtests skip under -short but this one does not", tName)
+	}
+}
+
+// isSubtestGuarded reports whether a t.Run closure is compliant: either it
+// guards itself directly, or every one of its own subtests is compliant.
+func isSubtestGuarded(lit *ast.FuncLit, cfg SkipByShortConfig, marked map[string]bool, tName string) bool {
+	if hasShortGuard(lit.Body.List, cfg, tName, marked) {
+		return true
+	}
+	subtests := collectSubtests(lit.Body.List, tName)
+	if len(subtests) == 0 {
+		return false
+	}
+	for _, sub := range subtests {
+		subName, ok := subtestTParamName(sub)
+		if !ok {
+			return false
+		}
+		if !isSubtestGuarded(sub, cfg, marked, subName) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectSubtests walks stmts for `tName.Run(name, func(tt *testing.T) {
+// ... })` calls, descending into the control-flow statements tests
+// commonly use to drive a table (for/range/if/switch), but not into
+// unrelated closures.
+func collectSubtests(stmts []ast.Stmt, tName string) []*ast.FuncLit {
+	var out []*ast.FuncLit
+	var walk func([]ast.Stmt)
+	walk = func(stmts []ast.Stmt) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *ast.ExprStmt:
+				if call, ok := s.X.(*ast.CallExpr); ok && matchCallExpr(call, tName, "Run") && len(call.Args) == 2 {
+					if lit, ok := call.Args[1].(*ast.FuncLit); ok {
+						out = append(out, lit)
+						continue
+					}
+				}
+			case *ast.BlockStmt:
+				walk(s.List)
+			case *ast.IfStmt:
+				walk(s.Body.List)
+				if s.Else != nil {
+					walk([]ast.Stmt{s.Else})
+				}
+			case *ast.ForStmt:
+				walk(s.Body.List)
+			case *ast.RangeStmt:
+				walk(s.Body.List)
+			case *ast.SwitchStmt:
+				for _, c := range s.Body.List {
+					if cc, ok := c.(*ast.CaseClause); ok {
+						walk(cc.Body)
 					}
 				}
 			}
 		}
-		lrp.AddReport(aNode.Pos(), fs, "Missing either 'if testing.Short() { t.Skip() }' or 'if !testing.Short() {}'")
 	}
-}
\ No newline at end of file
+	walk(stmts)
+	return out
+}
+
+// testingTParamName returns the name of fields' *testing.T parameter and
+// true, or "", false if no such parameter is found (e.g. the func doesn't
+// actually take a *testing.T despite its "Test" name). Callers must not
+// fall back to a guessed name: a guard or fix built around a nonexistent
+// parameter would reference an undefined identifier.
+func testingTParamName(fields *ast.FieldList) (string, bool) {
+	if fields == nil {
+		return "", false
+	}
+	for _, field := range fields.List {
+		star, ok := field.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		sel, ok := star.X.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "T" {
+			continue
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok || pkg.Name != "testing" {
+			continue
+		}
+		if len(field.Names) > 0 {
+			return field.Names[0].Name, true
+		}
+	}
+	return "", false
+}
+
+func subtestTParamName(lit *ast.FuncLit) (string, bool) {
+	return testingTParamName(lit.Type.Params)
+}
+
+// hasExemptBuildTag reports whether file carries a //go:build (or legacy
+// // +build) constraint with an unnegated reference to one of tags, e.g.
+// "integration" matches `//go:build integration` but not
+// `//go:build !integration`.
+func hasExemptBuildTag(file *ast.File, tags []string) bool {
+	if len(tags) == 0 {
+		return false
+	}
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			for _, tag := range tags {
+				if exprRequiresTag(expr, tag) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// exprRequiresTag reports whether expr contains an unnegated reference to
+// tag. A reference under a NotExpr doesn't count, so `!integration` does
+// not make a file match tag "integration".
+func exprRequiresTag(expr constraint.Expr, tag string) bool {
+	switch e := expr.(type) {
+	case *constraint.TagExpr:
+		return e.Tag == tag
+	case *constraint.AndExpr:
+		return exprRequiresTag(e.X, tag) || exprRequiresTag(e.Y, tag)
+	case *constraint.OrExpr:
+		return exprRequiresTag(e.X, tag) || exprRequiresTag(e.Y, tag)
+	default:
+		// *constraint.NotExpr, or anything else: don't count a
+		// reference hidden behind a negation.
+		return false
+	}
+}
+
+// skipGuardEdits returns the edits needed to prepend the skip guard to fn's
+// body, plus an import of "testing" if the file doesn't already have one.
+func skipGuardEdits(file *ast.File, fn *ast.FuncDecl, tName string) []analysis.TextEdit {
+	guard := "if testing.Short() {\n\t\t" + tName + `.Skip("skipping in short mode")` + "\n\t}\n\t"
+	edits := []analysis.TextEdit{
+		{
+			Pos:     fn.Body.Lbrace + 1,
+			End:     fn.Body.Lbrace + 1,
+			NewText: []byte("\n\t" + guard),
+		},
+	}
+	if imp := importEdit(file); imp != nil {
+		edits = append(edits, *imp)
+	}
+	return edits
+}
+
+// importEdit returns an edit adding a "testing" import to file, or nil if
+// file already imports it.
+func importEdit(file *ast.File) *analysis.TextEdit {
+	for _, imp := range file.Imports {
+		if imp.Path.Value == `"testing"` {
+			return nil
+		}
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if gen.Lparen.IsValid() {
+			return &analysis.TextEdit{
+				Pos:     gen.Lparen + 1,
+				End:     gen.Lparen + 1,
+				NewText: []byte("\n\t\"testing\""),
+			}
+		}
+		return &analysis.TextEdit{
+			Pos:     gen.End(),
+			End:     gen.End(),
+			NewText: []byte("\nimport \"testing\""),
+		}
+	}
+	return &analysis.TextEdit{
+		Pos:     file.Name.End(),
+		End:     file.Name.End(),
+		NewText: []byte("\n\nimport \"testing\""),
+	}
+}
+
+// hasShortGuard reports whether stmts contains a recognized guard anywhere
+// in its top-level statement list: a conditional skip (see isSkipCond), an
+// `if !testing.Short() { ... }` wrapper, or a call to one of
+// cfg.SkipHelpers. tName is the enclosing test's *testing.T parameter name.
+// marked is the set of function/method names in this package's files that
+// carry the istio:skipshort marker comment (see markedSkipHelpers).
+func hasShortGuard(stmts []ast.Stmt, cfg SkipByShortConfig, tName string, marked map[string]bool) bool {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.IfStmt:
+			if guardsOnShort(stmt, cfg, tName) {
+				return true
+			}
+		case *ast.ExprStmt:
+			if call, ok := stmt.X.(*ast.CallExpr); ok && isSkipHelperCall(call, cfg, marked) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// guardsOnShort reports whether ifStmt is one of the two top-level guard
+// shapes: `if !testing.Short() { ... }`, which wraps the real test body, or
+// `if <skip-condition> { tName.Skip(...) }`, which skips early.
+func guardsOnShort(ifStmt *ast.IfStmt, cfg SkipByShortConfig, tName string) bool {
+	if uExpr, ok := ifStmt.Cond.(*ast.UnaryExpr); ok && uExpr.Op == token.NOT {
+		if call, ok := uExpr.X.(*ast.CallExpr); ok {
+			return matchCallExpr(call, "testing", "Short")
+		}
+		return false
+	}
+	if !isSkipCond(ifStmt.Cond, cfg) || len(ifStmt.Body.List) == 0 {
+		return false
+	}
+	exprStmt, ok := ifStmt.Body.List[0].(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := exprStmt.X.(*ast.CallExpr)
+	return ok && matchCallExpr(call, tName, "Skip")
+}
+
+// isSkipCond reports whether cond is built entirely out of recognized
+// skip-triggering atoms, optionally combined with && or ||:
+//
+//   - testing.Short()
+//   - testenv.Builder() == ""
+//   - os.Getenv(name) == "", where name is listed in cfg.AllowedGuards
+//
+// When guards are combined with && or ||, every operand must itself be one
+// of these atoms; mixing in an unrecognized condition disqualifies the
+// whole expression.
+func isSkipCond(cond ast.Expr, cfg SkipByShortConfig) bool {
+	if bin, ok := cond.(*ast.BinaryExpr); ok && (bin.Op == token.LAND || bin.Op == token.LOR) {
+		return isSkipCond(bin.X, cfg) && isSkipCond(bin.Y, cfg)
+	}
+	if call, ok := cond.(*ast.CallExpr); ok {
+		return matchCallExpr(call, "testing", "Short")
+	}
+	bin, ok := cond.(*ast.BinaryExpr)
+	if !ok || bin.Op != token.EQL {
+		return false
+	}
+	lit, ok := bin.Y.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING || lit.Value != `""` {
+		return false
+	}
+	call, ok := bin.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	if matchCallExpr(call, "testenv", "Builder") {
+		return true
+	}
+	if matchCallExpr(call, "os", "Getenv") && len(call.Args) == 1 {
+		if arg, ok := call.Args[0].(*ast.BasicLit); ok && arg.Kind == token.STRING {
+			return contains(cfg.AllowedGuards, strings.Trim(arg.Value, `"`))
+		}
+	}
+	return false
+}
+
+// isSkipHelperCall reports whether call invokes one of cfg.SkipHelpers,
+// either directly (skipIfShort(t)) or as a method (suite.skipIfShort(t)),
+// and that helper's declaration in this package actually carries the
+// istio:skipshort marker comment (see markedSkipHelpers). A name listed in
+// cfg.SkipHelpers whose declaration isn't visible or isn't marked is not
+// trusted as a guard.
+func isSkipHelperCall(call *ast.CallExpr, cfg SkipByShortConfig, marked map[string]bool) bool {
+	var name string
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		name = fn.Name
+	case *ast.SelectorExpr:
+		name = fn.Sel.Name
+	default:
+		return false
+	}
+	return contains(cfg.SkipHelpers, name) && marked[name]
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCallExpr reports whether call is of the form recv.name(...), where
+// recv is an identifier equal to recv.
+func matchCallExpr(call *ast.CallExpr, recv, name string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && ident.Name == recv
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Istio Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules_test
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+
+	"istio.io/istio/tests/util/golinter/rules"
+)
+
+// TestSkipByShort covers the two base patterns from chunk0-1: a guarded
+// test is silent, an unguarded one is flagged.
+func TestSkipByShort(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), rules.NewSkipByShort(rules.SkipByShortConfig{}), "a")
+}
+
+// TestSkipByShortSuggestedFix covers chunk0-2: the missing guard is
+// rewritten in place via the analyzer's SuggestedFix.
+func TestSkipByShortSuggestedFix(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), rules.NewSkipByShort(rules.SkipByShortConfig{}), "fix")
+}
+
+// TestSkipByShortConfig covers chunk0-3: an allowed os.Getenv guard and a
+// marked skip helper are both accepted, while an unrelated unguarded test
+// in the same package is still flagged.
+func TestSkipByShortConfig(t *testing.T) {
+	cfg := rules.SkipByShortConfig{
+		AllowedGuards: []string{"ISTIO_FUZZ"},
+		SkipHelpers:   []string{"skipIfShort", "notMarked"},
+	}
+	analysistest.Run(t, analysistest.TestData(), rules.NewSkipByShort(cfg), "cfg")
+}
+
+// TestSkipByShortBuildTagExempt covers chunk0-3: a file whose //go:build
+// line names an exempt tag produces no diagnostics once that tag is part
+// of the build.
+func TestSkipByShortBuildTagExempt(t *testing.T) {
+	old := os.Getenv("GOFLAGS")
+	os.Setenv("GOFLAGS", old+" -tags=integration")
+	defer os.Setenv("GOFLAGS", old)
+
+	cfg := rules.SkipByShortConfig{ExemptBuildTags: []string{"integration"}}
+	analysistest.Run(t, analysistest.TestData(), rules.NewSkipByShort(cfg), "buildtag")
+}
+
+// TestSkipByShortBuildTagNegationNotExempt covers the review fix for
+// chunk0-3: a `//go:build !integration` file is not treated as exempt by
+// ExemptBuildTags: []string{"integration"} just because the tag name
+// appears in the constraint text.
+func TestSkipByShortBuildTagNegationNotExempt(t *testing.T) {
+	cfg := rules.SkipByShortConfig{ExemptBuildTags: []string{"integration"}}
+	analysistest.Run(t, analysistest.TestData(), rules.NewSkipByShort(cfg), "buildtagneg")
+}
+
+// TestSkipByShortSubtests covers chunk0-4: a test with no direct guard is
+// compliant when every t.Run subtest is guarded, flagged as a whole when
+// none are, and flagged per-subtest when only some are.
+func TestSkipByShortSubtests(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), rules.NewSkipByShort(rules.SkipByShortConfig{}), "subtest")
+}
+
+// TestSkipByShortSubtestsSuggestedFix covers the review fix for chunk0-4:
+// a table-driven test with no guarded subtest at all gets the same
+// SuggestedFix as a plain unguarded test, not a bare diagnostic.
+func TestSkipByShortSubtestsSuggestedFix(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), rules.NewSkipByShort(rules.SkipByShortConfig{}), "subtestfix")
+}
@@ -0,0 +1,20 @@
+package a
+
+import "testing"
+
+func TestGuardedWithSkip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	_ = 1
+}
+
+func TestGuardedWithNot(t *testing.T) {
+	if !testing.Short() {
+		_ = 1
+	}
+}
+
+func TestUnguarded(t *testing.T) { // want `missing either`
+	_ = 1
+}
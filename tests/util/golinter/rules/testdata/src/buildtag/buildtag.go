@@ -0,0 +1,9 @@
+//go:build integration
+
+package buildtag
+
+import "testing"
+
+func TestUnguarded(t *testing.T) {
+	_ = 1
+}
@@ -0,0 +1,9 @@
+//go:build !integration
+
+package buildtagneg
+
+import "testing"
+
+func TestUnguarded(t *testing.T) { // want `missing either`
+	_ = 1
+}
@@ -0,0 +1,60 @@
+package cfg
+
+import (
+	"os"
+	"testing"
+)
+
+// testenvStub stands in for golang.org/x/tools/internal/testenv's Builder
+// helper so this fixture can exercise the testenv.Builder() atom without
+// depending on an internal package.
+type testenvStub struct{}
+
+func (testenvStub) Builder() string { return "" }
+
+var testenv testenvStub
+
+func alwaysTrue() bool { return true }
+
+func TestEnvGuard(t *testing.T) {
+	if os.Getenv("ISTIO_FUZZ") == "" {
+		t.Skip("needs ISTIO_FUZZ")
+	}
+}
+
+func TestCombinedGuard(t *testing.T) {
+	if testing.Short() && testenv.Builder() == "" {
+		t.Skip("short and no builder")
+	}
+}
+
+func TestUnrecognizedOperandNotGuard(t *testing.T) { // want `missing either`
+	if testing.Short() && alwaysTrue() {
+		t.Skip("short")
+	}
+}
+
+// istio:skipshort
+func skipIfShort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short")
+	}
+}
+
+func notMarked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short")
+	}
+}
+
+func TestMarkedHelper(t *testing.T) {
+	skipIfShort(t)
+}
+
+func TestUnmarkedHelperNotTrusted(t *testing.T) { // want `missing either`
+	notMarked(t)
+}
+
+func TestUnguarded(t *testing.T) { // want `missing either`
+	_ = 1
+}
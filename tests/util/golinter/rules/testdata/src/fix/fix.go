@@ -0,0 +1,14 @@
+package fix
+
+import "testing"
+
+func TestUnguarded(t *testing.T) { // want `missing either`
+	_ = 1
+}
+
+// TestNoParam starts with "Test" but isn't a real go test func (no
+// *testing.T parameter), so it must not be flagged or "fixed" with a
+// guard that references an undefined t.
+func TestNoParam() {
+	_ = 1
+}
@@ -0,0 +1,39 @@
+package subtest
+
+import "testing"
+
+var cases = []struct{ name string }{{"a"}, {"b"}}
+
+// Every subtest guards itself, so the outer test is compliant even though
+// it has no direct guard.
+func TestAllSubtestsGuarded(t *testing.T) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(tt *testing.T) {
+			if testing.Short() {
+				tt.Skip("skipping in short mode")
+			}
+			_ = tc
+		})
+	}
+}
+
+// No subtest guards itself, so the whole table is flagged once.
+func TestNoSubtestsGuarded(t *testing.T) { // want `missing either`
+	for _, tc := range cases {
+		t.Run(tc.name, func(tt *testing.T) {
+			_ = tc
+		})
+	}
+}
+
+// Only some subtests guard themselves: each unguarded one is flagged.
+func TestMixedSubtests(t *testing.T) {
+	t.Run("guarded", func(tt *testing.T) {
+		if testing.Short() {
+			tt.Skip("skipping in short mode")
+		}
+	})
+	t.Run("unguarded", func(tt *testing.T) { // want `inconsistent testing.Short\(\) guard`
+		_ = 1
+	})
+}
@@ -0,0 +1,13 @@
+package subtestfix
+
+import "testing"
+
+var cases = []struct{ name string }{{"a"}, {"b"}}
+
+func TestNoSubtestsGuarded(t *testing.T) { // want `missing either`
+	for _, tc := range cases {
+		t.Run(tc.name, func(tt *testing.T) {
+			_ = tc
+		})
+	}
+}